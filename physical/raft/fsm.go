@@ -0,0 +1,544 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/vault/sdk/physical"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// databaseFilename is the name of the BoltDB file that backs the FSM,
+	// rooted at the raft data directory passed to NewFSM.
+	databaseFilename = "vault.db"
+
+	// dataBucketName holds the actual key/value pairs written by Vault.
+	dataBucketName = "data"
+
+	// configBucketName holds the latest applied index/term, so it survives a
+	// restart without a full replay. The latest raft configuration is kept
+	// in memory only and is not written to this bucket.
+	configBucketName = "config"
+
+	// chunkingBucketName holds in-flight chunks of writes that were split by
+	// ChunkLogData because they exceeded raft's max log size. It lives in
+	// the same BoltDB file as dataBucketName so that the existing
+	// file-level Snapshot/Restore implementation carries it along for free;
+	// a leader crash mid-upload can be resumed by whichever node restores
+	// the snapshot.
+	chunkingBucketName = "chunking"
+
+	latestIndexKey = "latest_indexes"
+)
+
+// FSM implements raft.FSM and raft.BatchingFSM on top of a local BoltDB
+// file. It is also used directly (outside of raft.Apply) by the physical
+// backend for reads, since reads don't need to go through consensus.
+type FSM struct {
+	l      sync.RWMutex
+	path   string
+	logger hclog.Logger
+
+	db *bolt.DB
+
+	// latestIndex and latestConfig cache the most recently applied index
+	// and raft configuration in memory so LatestState doesn't need to hit
+	// BoltDB on every call.
+	latestIndex  atomic.Value // *IndexValue
+	latestConfig atomic.Value // *raft.Configuration, may hold a nil pointer
+}
+
+// FSMApplyResponse is returned from FSM.Apply/ApplyBatch for every
+// raft.LogCommand entry. Success is always true: any failure to apply an
+// entry, including an unrecognized operation type or a storage error,
+// panics instead, consistent with raft's FSM contract that Apply must never
+// return an error.
+type FSMApplyResponse struct {
+	Success bool
+}
+
+// NewFSM opens (creating if necessary) the BoltDB file in path and returns
+// an FSM ready to be handed to raft.NewRaft. localID is accepted for parity
+// with callers that also construct a raft.Config from it, but is unused by
+// the FSM itself.
+func NewFSM(path string, localID string, logger hclog.Logger) (*FSM, error) {
+	dbPath := filepath.Join(path, databaseFilename)
+
+	db, err := bolt.Open(dbPath, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt file: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{dataBucketName, configBucketName, chunkingBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return fmt.Errorf("failed to create %q bucket: %w", bucket, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FSM{
+		path:   path,
+		logger: logger,
+		db:     db,
+	}
+	f.latestIndex.Store(&IndexValue{})
+	f.latestConfig.Store((*raft.Configuration)(nil))
+
+	if err := f.loadLatestState(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// loadLatestState populates the in-memory latestIndex cache from the config
+// bucket, so a restart doesn't forget what was already applied. It does not
+// touch latestConfig, which is not persisted.
+func (f *FSM) loadLatestState() error {
+	return f.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(configBucketName))
+
+		if raw := b.Get([]byte(latestIndexKey)); raw != nil {
+			index := &IndexValue{}
+			if err := proto.Unmarshal(raw, index); err != nil {
+				return fmt.Errorf("failed to decode latest index: %w", err)
+			}
+			f.latestIndex.Store(index)
+		}
+
+		return nil
+	})
+}
+
+// LatestState returns the index/term of the last log entry applied to the
+// FSM, along with the latest raft configuration it has observed. config is
+// nil until a raft.LogConfiguration entry has been applied since NewFSM
+// opened the FSM; it is not reloaded from disk after a restart.
+func (f *FSM) LatestState() (*IndexValue, *raft.Configuration) {
+	return f.latestIndex.Load().(*IndexValue), f.latestConfig.Load().(*raft.Configuration)
+}
+
+// Apply satisfies raft.FSM for callers that don't batch.
+func (f *FSM) Apply(log *raft.Log) interface{} {
+	resp := f.ApplyBatch([]*raft.Log{log})
+	if len(resp) != 1 {
+		panic(fmt.Sprintf("expected one response, got %d", len(resp)))
+	}
+	return resp[0]
+}
+
+// ApplyBatch satisfies raft.BatchingFSM. All logs in the batch are applied
+// inside a single BoltDB transaction so a crash mid-batch can't leave the
+// data bucket ahead of the in-memory latest index.
+func (f *FSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	responses := make([]interface{}, len(logs))
+
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(dataBucketName))
+		cb := tx.Bucket([]byte(chunkingBucketName))
+
+		var latestIndex *IndexValue
+		var latestConfig *raft.Configuration
+
+		for i, log := range logs {
+			latestIndex = &IndexValue{Term: log.Term, Index: log.Index}
+
+			switch log.Type {
+			case raft.LogCommand:
+				command := &LogData{}
+				if err := proto.Unmarshal(log.Data, command); err != nil {
+					return fmt.Errorf("error unmarshaling log data: %w", err)
+				}
+
+				if command.ChunkInfo != nil {
+					resp, err := f.applyChunk(b, cb, command.ChunkInfo)
+					if err != nil {
+						return err
+					}
+					responses[i] = resp
+					continue
+				}
+
+				if err := applyOperations(b, command.Operations); err != nil {
+					return err
+				}
+				responses[i] = &FSMApplyResponse{Success: true}
+
+			case raft.LogConfiguration:
+				configuration := raft.DecodeConfiguration(log.Data)
+				latestConfig = &configuration
+				responses[i] = nil
+
+			case raft.LogNoop:
+				responses[i] = nil
+
+			default:
+				return fmt.Errorf("unsupported log type: %s", log.Type)
+			}
+		}
+
+		raw, err := proto.Marshal(latestIndex)
+		if err != nil {
+			return fmt.Errorf("failed to marshal latest index: %w", err)
+		}
+		if err := tx.Bucket([]byte(configBucketName)).Put([]byte(latestIndexKey), raw); err != nil {
+			return err
+		}
+
+		f.latestIndex.Store(latestIndex)
+		if latestConfig != nil {
+			f.latestConfig.Store(latestConfig)
+		}
+
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to store data: %v", err))
+	}
+
+	return responses
+}
+
+// applyOperations performs the given operations against the data bucket.
+// It is also used by applyChunk once a chunked write has been fully
+// reassembled.
+func applyOperations(b *bolt.Bucket, ops []*LogOperation) error {
+	for _, op := range ops {
+		switch op.OpType {
+		case putOp:
+			if err := b.Put([]byte(op.Key), op.Value); err != nil {
+				return err
+			}
+		case deleteOp:
+			if err := b.Delete([]byte(op.Key)); err != nil {
+				return err
+			}
+		case restoreCallbackOp:
+			// No storage-level action; this marks a point in the log where
+			// a restore callback would historically have fired.
+		default:
+			return fmt.Errorf("%s is not a supported raft operation", op.OpType)
+		}
+	}
+	return nil
+}
+
+// Put writes an entry directly against the data bucket, bypassing raft.
+// It is used for reads/writes that the physical backend issues outside of
+// consensus (e.g. while catching up a follower, or in tests).
+func (f *FSM) Put(ctx context.Context, entry *physical.Entry) error {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(dataBucketName)).Put([]byte(entry.Key), entry.Value)
+	})
+}
+
+// Get reads an entry directly from the data bucket.
+func (f *FSM) Get(ctx context.Context, key string) (*physical.Entry, error) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	var value []byte
+	err := f.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(dataBucketName)).Get([]byte(key)); v != nil {
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	return &physical.Entry{Key: key, Value: value}, nil
+}
+
+// Delete removes an entry directly from the data bucket.
+func (f *FSM) Delete(ctx context.Context, key string) error {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(dataBucketName)).Delete([]byte(key))
+	})
+}
+
+// List returns every immediate child of prefix, using the same
+// '/'-delimited semantics as physical.Backend.List: each result is either a
+// leaf key or a "directory" name ending in '/'. It calls ListPage with an
+// unbounded limit, which means it materializes the full child set in
+// memory; callers working against a keyspace large enough for that to
+// matter should use ListPage or Walk instead.
+func (f *FSM) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, _, err := f.ListPage(ctx, prefix, "", 0)
+	return keys, err
+}
+
+// ListPage returns up to limit immediate children of prefix that sort after
+// the given cursor (the last child returned by a previous call), along with
+// an opaque cursor to pass as after on the next call to resume where this
+// one left off. A limit of 0 means unbounded. The returned cursor is the
+// last child in the returned page, even when that page reaches the end of
+// the prefix; it is empty only when the page itself is empty.
+func (f *FSM) ListPage(ctx context.Context, prefix, after string, limit int) ([]string, string, error) {
+	var keys []string
+
+	cursor, err := f.scanPrefix(ctx, prefix, after, limit, func(child string) error {
+		keys = append(keys, child)
+		return nil
+	})
+
+	return keys, cursor, err
+}
+
+// Walk streams every immediate child of prefix to fn without materializing
+// them into a slice first, which keeps memory bounded regardless of how
+// many keys live under prefix. fn can stop the walk early by returning
+// physical.ErrStopIteration; any other error aborts the walk and is
+// returned from Walk as-is. Walk also stops, returning ctx.Err(), if ctx is
+// done before it finishes.
+func (f *FSM) Walk(ctx context.Context, prefix string, fn func(key string) error) error {
+	_, err := f.scanPrefix(ctx, prefix, "", 0, fn)
+	return err
+}
+
+// scanPrefix is the cursor-based implementation shared by List, ListPage,
+// and Walk. It seeks to prefix+after and emits one level of '/'-delimited
+// children at a time, skipping the child named by after itself (it was
+// already emitted by whichever call produced that cursor) and collapsing
+// runs of keys that share a child into a single emission. It stops once
+// limit children have been emitted (limit <= 0 means unbounded), once fn
+// returns physical.ErrStopIteration, or once ctx is done, and returns the
+// last child it emitted so the caller can resume a paginated scan from
+// there.
+func (f *FSM) scanPrefix(ctx context.Context, prefix, after string, limit int, fn func(child string) error) (string, error) {
+	var cursor string
+	var count int
+
+	err := f.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(dataBucketName)).Cursor()
+
+		prefixBytes := []byte(prefix)
+		var lastChild string
+
+		for k, _ := c.Seek([]byte(prefix + after)); k != nil && bytes.HasPrefix(k, prefixBytes); k, _ = c.Next() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			remainder := strings.TrimPrefix(string(k), prefix)
+			if remainder == "" {
+				continue
+			}
+			child := remainder
+			if idx := strings.Index(remainder, "/"); idx != -1 {
+				child = remainder[:idx+1]
+			}
+			if child == after || child == lastChild {
+				continue
+			}
+			lastChild = child
+
+			if err := fn(child); err != nil {
+				if err == physical.ErrStopIteration {
+					cursor = child
+					return nil
+				}
+				return err
+			}
+
+			cursor = child
+			count++
+			if limit > 0 && count >= limit {
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return cursor, err
+}
+
+// ErrTxnCASMismatch is the Err on a *TxnError returned when a
+// physical.CheckAndSetOperation's expected value didn't match what was
+// actually stored under its key.
+var ErrTxnCASMismatch = fmt.Errorf("compare-and-set value mismatch")
+
+// TxnError identifies the operation within a Transaction call that caused
+// the whole transaction to abort, so callers can tell which write was
+// rejected instead of just that "a" write was.
+type TxnError struct {
+	Index int
+	Op    physical.Operation
+	Err   error
+}
+
+func (e *TxnError) Error() string {
+	return fmt.Sprintf("transaction operation %d (%s) failed: %v", e.Index, e.Op, e.Err)
+}
+
+func (e *TxnError) Unwrap() error { return e.Err }
+
+// Transaction applies a list of get/put/delete/check-and-set operations
+// against the data bucket inside a single BoltDB update, so either every
+// mutation commits or none do. physical.CheckAndSetOperation entries compare
+// the key's current value to Entry.Value and abort the whole transaction on
+// a mismatch, giving callers compare-and-set semantics on top of raft
+// storage. Each GET's value is captured as of the point it's processed in
+// the txn list (so a GET followed later in the same list by a PUT to the
+// same key still reads the pre-PUT value, matching how the naive
+// sequential implementation used to behave), but is only copied into the
+// caller's TxnEntry once the update has committed, so a caller can never
+// observe a read that happened underneath a transaction that ultimately
+// rolled back.
+func (f *FSM) Transaction(ctx context.Context, txns []*physical.TxnEntry) error {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	gotten := make(map[int][]byte)
+
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(dataBucketName))
+
+		for i, txn := range txns {
+			switch txn.Operation {
+			case physical.GetOperation:
+				if v := b.Get([]byte(txn.Entry.Key)); v != nil {
+					gotten[i] = append([]byte(nil), v...)
+				}
+
+			case physical.PutOperation:
+				if err := b.Put([]byte(txn.Entry.Key), txn.Entry.Value); err != nil {
+					return &TxnError{Index: i, Op: txn.Operation, Err: err}
+				}
+
+			case physical.DeleteOperation:
+				if err := b.Delete([]byte(txn.Entry.Key)); err != nil {
+					return &TxnError{Index: i, Op: txn.Operation, Err: err}
+				}
+
+			case physical.CheckAndSetOperation:
+				if current := b.Get([]byte(txn.Entry.Key)); !bytes.Equal(current, txn.Entry.Value) {
+					return &TxnError{Index: i, Op: txn.Operation, Err: ErrTxnCASMismatch}
+				}
+
+			default:
+				return &TxnError{Index: i, Op: txn.Operation, Err: fmt.Errorf("%q is not a supported transaction operation", txn.Operation)}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, value := range gotten {
+		txns[i].Entry.Value = value
+	}
+
+	return nil
+}
+
+// Stats returns the name of the underlying BoltDB file, primarily useful
+// for diagnostics/logging at startup.
+func (f *FSM) Stats() map[string]string {
+	return map[string]string{
+		"path": filepath.Join(f.path, databaseFilename),
+	}
+}
+
+// FSMSnapshot implements raft.FSMSnapshot by writing out a consistent copy
+// of the entire BoltDB file. Because the chunking bucket lives in the same
+// file as the data and config buckets, any chunks that were mid-flight when
+// the snapshot was taken are captured and restored automatically.
+type FSMSnapshot struct {
+	f *FSM
+}
+
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &FSMSnapshot{f: f}, nil
+}
+
+func (s *FSMSnapshot) Persist(sink raft.SnapshotSink) error {
+	s.f.l.RLock()
+	defer s.f.l.RUnlock()
+
+	err := s.f.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(sink)
+		return err
+	})
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *FSMSnapshot) Release() {}
+
+// Restore replaces the entire BoltDB file with the contents of r, which
+// must be a snapshot previously produced by FSMSnapshot.Persist.
+func (f *FSM) Restore(r io.ReadCloser) error {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if err := f.db.Close(); err != nil {
+		return fmt.Errorf("failed to close bolt file ahead of restore: %w", err)
+	}
+
+	dbPath := filepath.Join(f.path, databaseFilename)
+	tmpPath := dbPath + ".tmp"
+
+	tmpFH, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmpFH, r); err != nil {
+		tmpFH.Close()
+		return err
+	}
+	if err := tmpFH.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(dbPath, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	f.db = db
+
+	return f.loadLatestState()
+}
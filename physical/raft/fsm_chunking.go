@@ -0,0 +1,155 @@
+package raft
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	uuid "github.com/hashicorp/go-uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// generateCallID produces the CallId stamped on every chunk of a split
+// write so the FSM can correlate them back into a single logical write.
+func generateCallID() string {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		// uuid.GenerateUUID only fails if the system entropy source is
+		// unavailable, which would already be fatal for the raft transport
+		// itself; panicking here surfaces that loudly instead of silently
+		// colliding chunk keys.
+		panic(fmt.Sprintf("failed to generate chunk call id: %v", err))
+	}
+	return id
+}
+
+// chunkingSuccess is the response returned for every chunk of a split write
+// except the last. The caller (an ApplyFuture waiting on the reassembled
+// write) only cares about the response to the final chunk, which carries
+// the real result of applying the reassembled LogData.
+var chunkingSuccess = &FSMApplyResponse{Success: true}
+
+// ChunkLogData splits data into a sequence of LogData chunks whose
+// marshaled size is each no more than maxSize, suitable for submission as
+// individual raft.LogCommand entries via physical.Backend's write path.
+// Every chunk is itself a LogData{ChunkInfo{...}} envelope, not just the
+// raw bytes being carried, so the chunk boundaries are chosen to leave room
+// for that envelope rather than splitting the marshaled payload into
+// maxSize-sized pieces outright. The CallId stamped on every chunk
+// correlates them back into a single logical write for the FSM to
+// reassemble. If data already marshals to no more than maxSize bytes, it is
+// returned unchanged as the sole element of the result so callers don't
+// need to special-case small writes.
+func ChunkLogData(data *LogData, maxSize int) ([]*LogData, error) {
+	full, err := proto.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log data for chunking: %w", err)
+	}
+
+	if maxSize <= 0 || len(full) <= maxSize {
+		return []*LogData{data}, nil
+	}
+
+	callID := generateCallID()
+
+	payloadSize := maxSize - chunkOverhead(callID, uint64(len(full)), maxSize)
+	if payloadSize <= 0 {
+		return nil, fmt.Errorf("maxSize %d is too small to fit the chunking envelope", maxSize)
+	}
+
+	numChunks := (len(full) + payloadSize - 1) / payloadSize
+
+	chunks := make([]*LogData, numChunks)
+	for i := 0; i < numChunks; i++ {
+		start := i * payloadSize
+		end := start + payloadSize
+		if end > len(full) {
+			end = len(full)
+		}
+
+		chunks[i] = &LogData{
+			ChunkInfo: &LogDataChunkInfo{
+				SeqNum:     uint64(i),
+				NumChunks:  uint64(numChunks),
+				CallId:     callID,
+				OpaqueData: full[start:end],
+			},
+		}
+	}
+
+	return chunks, nil
+}
+
+// chunkOverhead returns an upper bound on the number of bytes ChunkLogData
+// adds around a chunk's opaque_data once it's wrapped in a
+// LogData{ChunkInfo{...}} envelope: the field tags and length prefixes for
+// both messages, plus seq_num/num_chunks/call_id. It's computed by
+// marshaling a probe chunk sized for the worst case this write could
+// produce — every index up to maxNumChunks, and an opaque_data field as
+// large as maxSize so its own length prefix is sized realistically — and
+// subtracting the probe payload's length back out. Because protobuf varint
+// encoding only grows with magnitude, this is safe to use for any smaller
+// seq_num, num_chunks, or opaque_data actually chosen afterward.
+func chunkOverhead(callID string, maxNumChunks uint64, maxSize int) int {
+	probePayload := make([]byte, maxSize)
+	probe := &LogData{
+		ChunkInfo: &LogDataChunkInfo{
+			SeqNum:     maxNumChunks,
+			NumChunks:  maxNumChunks,
+			CallId:     callID,
+			OpaqueData: probePayload,
+		},
+	}
+
+	marshaled, err := proto.Marshal(probe)
+	if err != nil {
+		// probe is a well-formed LogData; Marshal can't fail on it.
+		panic(fmt.Sprintf("failed to probe chunk overhead: %v", err))
+	}
+
+	return len(marshaled) - len(probePayload)
+}
+
+// applyChunk stores a single chunk of a split write in the chunking bucket
+// and, once every chunk sharing its CallId has arrived, reassembles the
+// original LogData and applies it against the data bucket. b and cb must
+// belong to the same BoltDB transaction that ApplyBatch is already holding
+// open, so reassembly and application happen atomically with every other
+// log in the batch.
+func (f *FSM) applyChunk(b, cb *bolt.Bucket, info *LogDataChunkInfo) (*FSMApplyResponse, error) {
+	if err := cb.Put(chunkBucketKey(info.CallId, info.SeqNum), info.OpaqueData); err != nil {
+		return nil, fmt.Errorf("failed to store chunk: %w", err)
+	}
+
+	for seq := uint64(0); seq < info.NumChunks; seq++ {
+		if cb.Get(chunkBucketKey(info.CallId, seq)) == nil {
+			return chunkingSuccess, nil
+		}
+	}
+
+	var full []byte
+	for seq := uint64(0); seq < info.NumChunks; seq++ {
+		key := chunkBucketKey(info.CallId, seq)
+		full = append(full, cb.Get(key)...)
+		if err := cb.Delete(key); err != nil {
+			return nil, fmt.Errorf("failed to clear chunk: %w", err)
+		}
+	}
+
+	reassembled := &LogData{}
+	if err := proto.Unmarshal(full, reassembled); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reassembled log data: %w", err)
+	}
+
+	if err := applyOperations(b, reassembled.Operations); err != nil {
+		return nil, err
+	}
+
+	return &FSMApplyResponse{Success: true}, nil
+}
+
+// chunkBucketKey namespaces a chunk's key within the chunking bucket by the
+// call it belongs to, so chunks from concurrent or interleaved writes never
+// collide.
+func chunkBucketKey(callID string, seqNum uint64) []byte {
+	return []byte(fmt.Sprintf("%s/%d", callID, seqNum))
+}
@@ -131,6 +131,135 @@ func TestFSM_Batching(t *testing.T) {
 	}
 }
 
+// TestFSM_Chunking exercises ChunkLogData/applyChunk reassembly for a
+// LogData well over raft's ~512KB max log size, including configuration
+// changes interleaved between chunks and a snapshot/restore performed
+// mid-upload.
+func TestFSM_Chunking(t *testing.T) {
+	fsm, dir := getFSM(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	const maxLogSize = 512 * 1024
+
+	big := &LogData{
+		Operations: []*LogOperation{
+			{
+				OpType: putOp,
+				Key:    "big-key",
+				Value:  bytes.Repeat([]byte("x"), 3*maxLogSize),
+			},
+		},
+	}
+
+	chunks, err := ChunkLogData(big, maxLogSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected chunking to split the payload, got %d chunk(s)", len(chunks))
+	}
+	for i, c := range chunks {
+		marshaled, err := proto.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(marshaled) > maxLogSize {
+			t.Fatalf("chunk %d marshals to %d bytes, over the %d byte limit it exists to stay under", i, len(marshaled), maxLogSize)
+		}
+	}
+
+	var index uint64
+	applyChunk := func(data *LogData) interface{} {
+		index++
+		commandBytes, err := proto.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := fsm.ApplyBatch([]*raft.Log{{
+			Index: index,
+			Term:  1,
+			Type:  raft.LogCommand,
+			Data:  commandBytes,
+		}})
+		return resp[0]
+	}
+
+	// Apply all but the last chunk, interleaving a configuration change,
+	// then snapshot and restore into a fresh FSM before finishing the
+	// upload. The restored FSM must resume reassembly using the chunking
+	// bucket it inherited from the snapshot.
+	for _, c := range chunks[:len(chunks)-1] {
+		resp := applyChunk(c)
+		if r, ok := resp.(*FSMApplyResponse); !ok || !r.Success {
+			t.Fatalf("bad in-progress chunk response: %#v", resp)
+		}
+	}
+
+	index++
+	fsm.ApplyBatch([]*raft.Log{{
+		Index: index,
+		Term:  1,
+		Type:  raft.LogConfiguration,
+		Data: raft.EncodeConfiguration(raft.Configuration{
+			Servers: []raft.Server{{Address: "test", ID: "test"}},
+		}),
+	}})
+
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoredFSM, restoredDir := getFSM(t)
+	defer func() { _ = os.RemoveAll(restoredDir) }()
+
+	sink := &testSnapshotSink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoredFSM.Restore(ioutil.NopCloser(bytes.NewReader(sink.buf.Bytes()))); err != nil {
+		t.Fatal(err)
+	}
+
+	last := chunks[len(chunks)-1]
+	index++
+	commandBytes, err := proto.Marshal(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := restoredFSM.ApplyBatch([]*raft.Log{{
+		Index: index,
+		Term:  1,
+		Type:  raft.LogCommand,
+		Data:  commandBytes,
+	}})
+	if r, ok := resp[0].(*FSMApplyResponse); !ok || !r.Success {
+		t.Fatalf("bad final chunk response: %#v", resp[0])
+	}
+
+	entry, err := restoredFSM.Get(context.Background(), "big-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Fatal("expected reassembled entry to be present")
+	}
+	if !bytes.Equal(entry.Value, big.Operations[0].Value) {
+		t.Fatal("reassembled value does not match original")
+	}
+}
+
+// testSnapshotSink is a minimal in-memory raft.SnapshotSink for exercising
+// FSMSnapshot.Persist/FSM.Restore without a real raft.SnapshotStore.
+type testSnapshotSink struct {
+	buf bytes.Buffer
+}
+
+func (s *testSnapshotSink) Write(p []byte) (int, error) { return s.buf.Write(p) }
+func (s *testSnapshotSink) Close() error                { return nil }
+func (s *testSnapshotSink) ID() string                  { return "test" }
+func (s *testSnapshotSink) Cancel() error               { return nil }
+
 func TestFSM_List(t *testing.T) {
 	fsm, dir := getFSM(t)
 	defer func() { _ = os.RemoveAll(dir) }()
@@ -162,6 +291,128 @@ func TestFSM_List(t *testing.T) {
 	}
 }
 
+// TestFSM_ListPage verifies that paging through a prefix with a small limit
+// reproduces the same set and order as a single unbounded List call, with
+// no duplicated or skipped children across page boundaries, including keys
+// whose names embed additional slashes.
+func TestFSM_ListPage(t *testing.T) {
+	fsm, dir := getFSM(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ctx := context.Background()
+	count := 37
+	for _, k := range rand.Perm(count) {
+		if err := fsm.Put(ctx, &physical.Entry{Key: fmt.Sprintf("foo/%03d/bar/baz", k)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := fsm.List(ctx, "foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(want)
+
+	var got []string
+	var after string
+	for {
+		page, cursor, err := fsm.ListPage(ctx, "foo/", after, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		got = append(got, page...)
+		after = cursor
+		if len(page) < 4 {
+			break
+		}
+	}
+
+	if diff := deep.Equal(want, got); len(diff) > 0 {
+		t.Fatal(diff)
+	}
+}
+
+// TestFSM_ListPage_CursorStability verifies that a cursor obtained before a
+// concurrent write still resumes correctly: pages already handed out are
+// unaffected by keys written under prefixes that sort before the cursor.
+func TestFSM_ListPage_CursorStability(t *testing.T) {
+	fsm, dir := getFSM(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ctx := context.Background()
+	for _, k := range []string{"a", "c", "e", "g"} {
+		if err := fsm.Put(ctx, &physical.Entry{Key: "foo/" + k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, cursor, err := fsm.ListPage(ctx, "foo/", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]string{"a", "c"}, page); len(diff) > 0 {
+		t.Fatal(diff)
+	}
+
+	// Concurrent write sorts before the cursor; it must not reappear or
+	// shift the next page.
+	if err := fsm.Put(ctx, &physical.Entry{Key: "foo/b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, _, err = fsm.ListPage(ctx, "foo/", cursor, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]string{"e", "g"}, page); len(diff) > 0 {
+		t.Fatal(diff)
+	}
+}
+
+// TestFSM_Walk verifies that Walk streams the same keys List would return,
+// and that returning physical.ErrStopIteration halts it early.
+func TestFSM_Walk(t *testing.T) {
+	fsm, dir := getFSM(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ctx := context.Background()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if err := fsm.Put(ctx, &physical.Entry{Key: "foo/" + k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var walked []string
+	err := fsm.Walk(ctx, "foo/", func(key string) error {
+		walked = append(walked, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]string{"a", "b", "c", "d"}, walked); len(diff) > 0 {
+		t.Fatal(diff)
+	}
+
+	walked = nil
+	err = fsm.Walk(ctx, "foo/", func(key string) error {
+		walked = append(walked, key)
+		if key == "b" {
+			return physical.ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal([]string{"a", "b"}, walked); len(diff) > 0 {
+		t.Fatal(diff)
+	}
+}
+
 func TestFSM_Transaction(t *testing.T) {
 	fsm, dir := getFSM(t)
 	defer func() { _ = os.RemoveAll(dir) }()
@@ -214,3 +465,94 @@ func TestFSM_Transaction(t *testing.T) {
 		}
 	}
 }
+
+// TestFSM_Transaction_Rollback verifies that a failing operation partway
+// through a transaction aborts the entire transaction: none of the writes
+// before it become visible, and the returned error identifies which
+// operation caused the abort.
+func TestFSM_Transaction_Rollback(t *testing.T) {
+	fsm, dir := getFSM(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ctx := context.Background()
+
+	txns := []*physical.TxnEntry{
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/0", Value: []byte("value-0")}},
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/1", Value: []byte("value-1")}},
+		// A CAS check against a key that doesn't exist yet (and so can't
+		// equal the expected value) should abort everything above it too.
+		{Operation: physical.CheckAndSetOperation, Entry: &physical.Entry{Key: "foo/2", Value: []byte("expected")}},
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/3", Value: []byte("value-3")}},
+	}
+
+	err := fsm.Transaction(ctx, txns)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	txnErr, ok := err.(*TxnError)
+	if !ok {
+		t.Fatalf("expected a *TxnError, got %T: %v", err, err)
+	}
+	if txnErr.Index != 2 {
+		t.Fatalf("expected the failure to be attributed to index 2, got %d", txnErr.Index)
+	}
+	if txnErr.Op != physical.CheckAndSetOperation {
+		t.Fatalf("expected the failing op to be CheckAndSetOperation, got %s", txnErr.Op)
+	}
+
+	keys, err := fsm.List(ctx, "foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected no keys to be visible after rollback, got %v", keys)
+	}
+}
+
+// TestFSM_Transaction_CheckAndSet verifies compare-and-set semantics: a
+// matching expected value lets the rest of the transaction through, and a
+// mismatched one rejects it without writing anything.
+func TestFSM_Transaction_CheckAndSet(t *testing.T) {
+	fsm, dir := getFSM(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ctx := context.Background()
+	if err := fsm.Put(ctx, &physical.Entry{Key: "foo/cas", Value: []byte("original")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mismatched expected value: the whole transaction should be rejected.
+	err := fsm.Transaction(ctx, []*physical.TxnEntry{
+		{Operation: physical.CheckAndSetOperation, Entry: &physical.Entry{Key: "foo/cas", Value: []byte("wrong")}},
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/cas", Value: []byte("updated")}},
+	})
+	if err == nil {
+		t.Fatal("expected a CAS mismatch error")
+	}
+
+	entry, err := fsm.Get(ctx, "foo/cas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entry.Value, []byte("original")) {
+		t.Fatalf("expected value to be unchanged after failed CAS, got %s", entry.Value)
+	}
+
+	// Matching expected value: the transaction should commit.
+	err = fsm.Transaction(ctx, []*physical.TxnEntry{
+		{Operation: physical.CheckAndSetOperation, Entry: &physical.Entry{Key: "foo/cas", Value: []byte("original")}},
+		{Operation: physical.PutOperation, Entry: &physical.Entry{Key: "foo/cas", Value: []byte("updated")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err = fsm.Get(ctx, "foo/cas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entry.Value, []byte("updated")) {
+		t.Fatalf("expected value to be updated after successful CAS, got %s", entry.Value)
+	}
+}
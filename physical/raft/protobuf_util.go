@@ -0,0 +1,87 @@
+package raft
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// wireType mirrors the protobuf wire types used by the hand rolled
+// encode/decode helpers below. Only varint and length-delimited fields are
+// needed by the messages in types.pb.go.
+type wireType int
+
+const (
+	wireVarint  wireType = 0
+	wireBytes   wireType = 2
+)
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = appendVarint(buf, uint64(field)<<3|uint64(wireVarint))
+	return appendVarint(buf, v)
+}
+
+func appendBytesField(buf []byte, field int, v []byte) []byte {
+	buf = appendVarint(buf, uint64(field)<<3|uint64(wireBytes))
+	buf = appendVarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// decodeFields walks a length-delimited protobuf message, invoking fn once
+// per field with the field number, wire type, and raw payload (the varint
+// value or the bytes payload, depending on wire type).
+func decodeFields(data []byte, fn func(field int, wire wireType, raw []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("raft: invalid protobuf key")
+		}
+		data = data[n:]
+
+		field := int(key >> 3)
+		wire := wireType(key & 0x7)
+
+		switch wire {
+		case wireVarint:
+			_, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("raft: invalid protobuf varint")
+			}
+			raw := data[:n]
+			data = data[n:]
+			if err := fn(field, wire, raw); err != nil {
+				return err
+			}
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("raft: invalid protobuf length")
+			}
+			data = data[n:]
+			if uint64(len(data)) < l {
+				return fmt.Errorf("raft: truncated protobuf payload")
+			}
+			raw := data[:l]
+			data = data[l:]
+			if err := fn(field, wire, raw); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("raft: unsupported protobuf wire type %d", wire)
+		}
+	}
+	return nil
+}
+
+func decodeVarint(raw []byte) (uint64, error) {
+	v, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return 0, fmt.Errorf("raft: invalid protobuf varint")
+	}
+	return v, nil
+}
@@ -0,0 +1,79 @@
+// Package physical defines the interface physical storage backends
+// implement, and the handful of shared types (Entry, TxnEntry, Operation)
+// that every backend's callers and implementations speak in terms of.
+package physical
+
+import (
+	"context"
+	"errors"
+)
+
+// Backend is the interface required for a physical backend. A physical
+// backend is used to durably store data outside of Vault, and is the only
+// layer that deals in raw key/value pairs rather than logical paths.
+type Backend interface {
+	Put(ctx context.Context, entry *Entry) error
+	Get(ctx context.Context, key string) (*Entry, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Transactional is implemented by physical backends that can run a list of
+// operations as a single atomic unit.
+type Transactional interface {
+	Transaction(ctx context.Context, txns []*TxnEntry) error
+}
+
+// Entry is used to represent data stored by a physical backend.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// Operation identifies the kind of read or mutation a TxnEntry performs.
+type Operation string
+
+const (
+	GetOperation         Operation = "get"
+	PutOperation         Operation = "put"
+	DeleteOperation      Operation = "delete"
+	CheckAndSetOperation Operation = "check-and-set"
+)
+
+// TxnEntry is a single operation submitted as part of a Transaction call.
+//
+// For GetOperation, Entry.Value is populated with the key's value once the
+// transaction commits; it must not be read before Transaction returns.
+//
+// For CheckAndSetOperation, Entry.Value holds the value Entry.Key is
+// expected to currently have. If the stored value doesn't match, the whole
+// transaction is aborted and none of its other operations take effect.
+// TxnCheckEntry.AsTxnEntry builds this shape from a (key, expected) pair.
+type TxnEntry struct {
+	Operation Operation
+	Entry     *Entry
+}
+
+// TxnCheckEntry describes a compare-and-set guard for use inside a
+// Transaction call: the transaction aborts unless Key's current value
+// equals Expected. Callers building optimistic-concurrency flows construct
+// one of these and fold it into the []*TxnEntry slice with AsTxnEntry
+// alongside the writes it should gate.
+type TxnCheckEntry struct {
+	Key      string
+	Expected []byte
+}
+
+// AsTxnEntry converts c into the CheckAndSetOperation TxnEntry that
+// Transaction implementations key their compare-and-set handling on.
+func (c *TxnCheckEntry) AsTxnEntry() *TxnEntry {
+	return &TxnEntry{
+		Operation: CheckAndSetOperation,
+		Entry:     &Entry{Key: c.Key, Value: c.Expected},
+	}
+}
+
+// ErrStopIteration is returned by a streaming iteration callback (such as
+// the fn passed to FSM.Walk) to stop iteration early without that being
+// treated as a failure.
+var ErrStopIteration = errors.New("physical: stop iteration")